@@ -0,0 +1,34 @@
+package libpod
+
+import (
+	"github.com/containers/libpod/libpod/define"
+)
+
+// ContainerConfig contains the configuration data for a container that is
+// fixed at create time and stored on disk. This is a subset of the real
+// config - only the fields this tree's code actually reads or writes.
+type ContainerConfig struct {
+	// ID is the container's unique ID.
+	ID string
+	// Name is the container's human-readable name.
+	Name string
+
+	// PortMappings is the set of range-aware port mappings requested for
+	// this container - see define.PortMapping. Containers created before
+	// PortMapping existed store the legacy flattened []ocicni.PortMapping
+	// form instead; loadPortMappings handles migrating that on read.
+	PortMappings []define.PortMapping
+
+	// CgroupParent is the slice (or cgroupfs parent) the container's
+	// cgroup(s) are created under.
+	CgroupParent string
+	// CgroupMode selects how the container's cgroup is set up - see
+	// define.CgroupModeConmonDelegated for the only mode handled
+	// specially today.
+	CgroupMode string
+}
+
+// Container is a single OCI container managed by libpod.
+type Container struct {
+	config *ContainerConfig
+}
@@ -0,0 +1,25 @@
+package libpod
+
+import "github.com/containers/libpod/libpod/define"
+
+// exposedPortsForInspect renders a container's tracked exposed ports
+// (container port to protocols) in the form `podman inspect` reports them
+// under Config.ExposedPorts.
+func exposedPortsForInspect(exposed map[uint16][]string) map[string]struct{} {
+	return define.FormatExposedPorts(exposed)
+}
+
+// mergeExposedPortsForCommit merges a container's tracked exposed ports
+// into the ExposedPorts map of the image config Container.Commit is
+// writing out, so `podman commit` preserves the EXPOSE lines from the base
+// image (and any --expose flags) even for a container that was never run
+// with -P. imageExposedPorts may be nil.
+func mergeExposedPortsForCommit(imageExposedPorts map[string]struct{}, exposed map[uint16][]string) map[string]struct{} {
+	if imageExposedPorts == nil {
+		imageExposedPorts = make(map[string]struct{})
+	}
+	for portProto := range define.FormatExposedPorts(exposed) {
+		imageExposedPorts[portProto] = struct{}{}
+	}
+	return imageExposedPorts
+}
@@ -0,0 +1,32 @@
+package libpod
+
+import "testing"
+
+func TestExposedPortsForInspect(t *testing.T) {
+	got := exposedPortsForInspect(map[uint16][]string{6379: {"tcp"}})
+	if _, ok := got["6379/tcp"]; !ok || len(got) != 1 {
+		t.Fatalf("unexpected inspect payload: %+v", got)
+	}
+}
+
+func TestMergeExposedPortsForCommit(t *testing.T) {
+	existing := map[string]struct{}{"80/tcp": {}}
+
+	merged := mergeExposedPortsForCommit(existing, map[uint16][]string{6379: {"tcp", "udp"}})
+
+	for _, want := range []string{"80/tcp", "6379/tcp", "6379/udp"} {
+		if _, ok := merged[want]; !ok {
+			t.Fatalf("expected %q in merged exposed ports, got %+v", want, merged)
+		}
+	}
+	if len(merged) != 3 {
+		t.Fatalf("expected exactly 3 entries, got %+v", merged)
+	}
+}
+
+func TestMergeExposedPortsForCommitNilInput(t *testing.T) {
+	merged := mergeExposedPortsForCommit(nil, map[uint16][]string{80: {"tcp"}})
+	if _, ok := merged["80/tcp"]; !ok || len(merged) != 1 {
+		t.Fatalf("unexpected merged result from nil input: %+v", merged)
+	}
+}
@@ -0,0 +1,45 @@
+package libpod
+
+import (
+	"github.com/containers/libpod/libpod/define"
+	"github.com/containers/libpod/pkg/cgroups"
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// applyConmonDelegatedCgroup points g's cgroupsPath at cgroupsPath when one
+// was produced (i.e. the container is running in conmon-delegated cgroup
+// mode - see startConmonDelegatedScope); for every other cgroup mode,
+// cgroupsPath is empty and g is left untouched, preserving the OCI
+// runtime's usual choice of a sibling libpod-$ID.scope.
+func applyConmonDelegatedCgroup(g *spec.Spec, cgroupsPath string) {
+	if cgroupsPath == "" {
+		return
+	}
+	if g.Linux == nil {
+		g.Linux = &spec.Linux{}
+	}
+	g.Linux.CgroupsPath = cgroupsPath
+}
+
+// prepareConmonCgroup validates c's requested cgroup mode against this
+// host, and - for conmon-delegated mode - starts conmon's delegated scope
+// and points g's cgroupsPath at it, so the OCI runtime creates the
+// container payload inside the same cgroup conmon is already running
+// under. It's called from the container creation path right after conmon
+// has been started, once its PID is known.
+func (c *Container) prepareConmonCgroup(g *spec.Spec, conmonPID int) error {
+	unified, err := cgroups.IsCgroup2UnifiedMode()
+	if err != nil {
+		return err
+	}
+	if err := define.ValidateCgroupMode(c.config.CgroupMode, unified); err != nil {
+		return err
+	}
+
+	cgroupsPath, err := startConmonDelegatedScope(c.config.CgroupMode, conmonPID, c.config.CgroupParent, c.config.ID)
+	if err != nil {
+		return err
+	}
+	applyConmonDelegatedCgroup(g, cgroupsPath)
+	return nil
+}
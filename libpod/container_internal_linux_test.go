@@ -0,0 +1,19 @@
+package libpod
+
+import (
+	"testing"
+
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestPrepareConmonCgroupNoopForDefaultMode(t *testing.T) {
+	c := &Container{config: &ContainerConfig{ID: "abc", CgroupParent: "user.slice"}}
+	g := &spec.Spec{}
+
+	if err := c.prepareConmonCgroup(g, 1); err != nil {
+		t.Fatalf("unexpected error for the default cgroup mode: %v", err)
+	}
+	if g.Linux != nil {
+		t.Fatalf("expected Linux to be left nil for the default cgroup mode, got %+v", g.Linux)
+	}
+}
@@ -0,0 +1,26 @@
+package define
+
+import "github.com/pkg/errors"
+
+const (
+	// CgroupModeConmonDelegated is the cgroup mode for reusing a single
+	// delegated cgroup for both conmon and the container payload.
+	CgroupModeConmonDelegated = "conmon-delegated"
+)
+
+// ValidateCgroupMode rejects cgroup modes the host can't support.
+// CgroupModeConmonDelegated is a cgroup v2 concept - v1 has no single
+// subtree that conmon and its payload can share the way this mode
+// requires - so it's rejected when unifiedCgroups (the result of
+// cgroups.IsCgroup2UnifiedMode) is false. unifiedCgroups is passed in
+// rather than detected here so callers can unit test against both cases
+// without needing an actual cgroup v1 or v2 host.
+func ValidateCgroupMode(cgroupMode string, unifiedCgroups bool) error {
+	if cgroupMode != CgroupModeConmonDelegated {
+		return nil
+	}
+	if !unifiedCgroups {
+		return errors.Errorf("cgroup mode %q is only supported on cgroup v2 hosts", CgroupModeConmonDelegated)
+	}
+	return nil
+}
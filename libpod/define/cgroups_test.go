@@ -0,0 +1,29 @@
+package define
+
+import "testing"
+
+func TestValidateCgroupMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		cgroupMode string
+		unified    bool
+		wantErr    bool
+	}{
+		{"default mode on v1", "", false, false},
+		{"default mode on v2", "", true, false},
+		{"delegated on v1", CgroupModeConmonDelegated, false, true},
+		{"delegated on v2", CgroupModeConmonDelegated, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCgroupMode(tt.cgroupMode, tt.unified)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package define
+
+import "fmt"
+
+// PortMapping is a complete description of a range of ports to forward from
+// the host into a container. Unlike the ocicni.PortMapping it replaces as
+// the on-disk and over-the-wire representation, a single PortMapping can
+// describe an entire contiguous range of ports instead of just one, so a
+// container published with a wide `-p` range no longer needs one entry per
+// port.
+type PortMapping struct {
+	// HostIP is the IP that we will bind to on the host.
+	// If unset, assumed to be 0.0.0.0 (all interfaces).
+	HostIP string `json:"host_ip,omitempty"`
+	// ContainerPort is the first port number that will be exposed from
+	// the container.
+	ContainerPort uint16 `json:"container_port"`
+	// HostPort is the first port number that will be forwarded from the
+	// host into the container.
+	HostPort uint16 `json:"host_port"`
+	// Range is the number of ports that will be forwarded, starting at
+	// ContainerPort and HostPort and counting up. A Range of 0 or 1
+	// indicates that only a single port is forwarded.
+	Range uint16 `json:"range,omitempty"`
+	// Protocol is the protocol forward. Must be "tcp", "udp", or "sctp".
+	Protocol string `json:"protocol"`
+}
+
+// FormatExposedPorts renders a container's exposed ports (container port to
+// protocols, as returned by generate.CompleteSpec) in the
+// "portNumber/protocol" form used by both `podman inspect`'s
+// Config.ExposedPorts and the EXPOSE lines of a committed image's config.
+func FormatExposedPorts(exposed map[uint16][]string) map[string]struct{} {
+	formatted := make(map[string]struct{}, len(exposed))
+	for port, protocols := range exposed {
+		for _, proto := range protocols {
+			formatted[fmt.Sprintf("%d/%s", port, proto)] = struct{}{}
+		}
+	}
+	return formatted
+}
@@ -1,7 +1,57 @@
 package libpod
 
-const (
-	// conmonDelegated is the cgroup mode for reusing the current cgroup both
-	// for conmon and for the container payload.
-	conmonDelegated = "conmon-delegated"
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/containers/libpod/libpod/define"
+	"github.com/containers/libpod/pkg/cgroups"
+	"github.com/containers/libpod/utils"
+	"github.com/pkg/errors"
 )
+
+// conmonDelegated is the cgroup mode for running conmon and the container
+// payload under a single delegated cgroup.
+const conmonDelegated = define.CgroupModeConmonDelegated
+
+// conmonDelegatedCgroupPath returns the cgroupfs path the OCI spec's
+// cgroupsPath should point at when running in conmon-delegated mode, given
+// conmonCgroup (conmon's own scope, as started by startConmonDelegatedScope
+// below). The container payload lives in a subtree underneath it, rather
+// than in a sibling scope of its own, so conmon and the payload always end
+// up under the same delegated cgroup.
+func conmonDelegatedCgroupPath(conmonCgroup, ctrID string) string {
+	return filepath.Join(conmonCgroup, ctrID)
+}
+
+// startConmonDelegatedScope validates that cgroupMode is usable on this
+// host, and - if it's conmonDelegated - starts conmon's transient systemd
+// scope with Delegate=true and returns the cgroupsPath the container
+// payload's OCI spec should be given so it lands inside that same scope
+// instead of a sibling libpod-$ID.scope.
+//
+// For every other cgroup mode this returns ("", nil): today's behavior of
+// letting the OCI runtime create its own sibling scope is left untouched.
+//
+// Its caller is Container.prepareConmonCgroup, which merges the returned
+// path into the generated OCI spec via applyConmonDelegatedCgroup.
+func startConmonDelegatedScope(cgroupMode string, conmonPID int, slice, ctrID string) (string, error) {
+	if cgroupMode != conmonDelegated {
+		return "", nil
+	}
+
+	unified, err := cgroups.IsCgroup2UnifiedMode()
+	if err != nil {
+		return "", err
+	}
+	if err := define.ValidateCgroupMode(cgroupMode, unified); err != nil {
+		return "", err
+	}
+
+	conmonCgroup, err := utils.RunUnderSystemdScopeDelegated(conmonPID, slice, fmt.Sprintf("libpod-conmon-%s.scope", ctrID))
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating conmon-delegated scope for container %s", ctrID)
+	}
+
+	return conmonDelegatedCgroupPath(conmonCgroup, ctrID), nil
+}
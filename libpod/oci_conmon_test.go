@@ -0,0 +1,41 @@
+package libpod
+
+import (
+	"testing"
+
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestConmonDelegatedCgroupPath(t *testing.T) {
+	got := conmonDelegatedCgroupPath("/user.slice/user-1000.slice/libpod-conmon-abc.scope", "abc")
+	want := "/user.slice/user-1000.slice/libpod-conmon-abc.scope/abc"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestApplyConmonDelegatedCgroup(t *testing.T) {
+	g := &spec.Spec{}
+
+	// Non-delegated mode: an empty cgroupsPath must leave the spec alone.
+	applyConmonDelegatedCgroup(g, "")
+	if g.Linux != nil {
+		t.Fatalf("expected Linux to be left nil for an empty cgroupsPath, got %+v", g.Linux)
+	}
+
+	// Delegated mode: the provided path must be merged in.
+	applyConmonDelegatedCgroup(g, "/user.slice/libpod-conmon-abc.scope/abc")
+	if g.Linux == nil || g.Linux.CgroupsPath != "/user.slice/libpod-conmon-abc.scope/abc" {
+		t.Fatalf("unexpected Linux.CgroupsPath: %+v", g.Linux)
+	}
+}
+
+func TestStartConmonDelegatedScopeNoopForOtherModes(t *testing.T) {
+	path, err := startConmonDelegatedScope("", 1, "user.slice", "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "" {
+		t.Fatalf("expected no cgroupsPath for the default cgroup mode, got %q", path)
+	}
+}
@@ -0,0 +1,106 @@
+package libpod
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/containers/libpod/libpod/define"
+	"github.com/cri-o/ocicni/pkg/ocicni"
+	"github.com/pkg/errors"
+)
+
+// loadPortMappings unmarshals a container's stored port mappings, migrating
+// them from the legacy flattened []ocicni.PortMapping representation to
+// []define.PortMapping if needed. This is the state read path's entry
+// point: Container.loadPortMappingsInto calls it instead of unmarshaling
+// config.PortMappings itself, so every container load goes through the
+// same migration regardless of which bucket it came from.
+//
+// define.PortMapping and ocicni.PortMapping serialize their container port
+// under different JSON keys ("container_port" vs "containerPort"), so
+// unmarshaling legacy data directly into []define.PortMapping silently
+// leaves ContainerPort at its zero value on every entry - a state otherwise
+// impossible, since 0 is never a valid port number. That's used below as an
+// unambiguous signal to fall back to the legacy schema and migrate it.
+func loadPortMappings(raw []byte) ([]define.PortMapping, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var mappings []define.PortMapping
+	if err := json.Unmarshal(raw, &mappings); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling port mappings")
+	}
+
+	for _, m := range mappings {
+		if m.ContainerPort == 0 {
+			var legacy []ocicni.PortMapping
+			if err := json.Unmarshal(raw, &legacy); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling legacy port mappings")
+			}
+			return migrateLegacyPortMappings(legacy), nil
+		}
+	}
+
+	return mappings, nil
+}
+
+// migrateLegacyPortMappings converts the flat []ocicni.PortMapping slice
+// used to store a container's published ports before define.PortMapping
+// existed into the range-aware representation.
+//
+// Runs of ports with identical HostIP and Protocol whose HostPort and
+// ContainerPort both increase by exactly 1 between consecutive entries are
+// collapsed back into a single ranged define.PortMapping.
+func migrateLegacyPortMappings(legacy []ocicni.PortMapping) []define.PortMapping {
+	sorted := make([]ocicni.PortMapping, len(legacy))
+	copy(sorted, legacy)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Protocol != sorted[j].Protocol {
+			return sorted[i].Protocol < sorted[j].Protocol
+		}
+		if sorted[i].HostIP != sorted[j].HostIP {
+			return sorted[i].HostIP < sorted[j].HostIP
+		}
+		return sorted[i].HostPort < sorted[j].HostPort
+	})
+
+	migrated := []define.PortMapping{}
+	for _, p := range sorted {
+		if len(migrated) > 0 {
+			last := &migrated[len(migrated)-1]
+			length := last.Range
+			if length == 0 {
+				length = 1
+			}
+			sameGroup := last.Protocol == p.Protocol && last.HostIP == p.HostIP
+			contiguous := int(last.HostPort)+int(length) == int(p.HostPort) &&
+				int(last.ContainerPort)+int(length) == int(p.ContainerPort)
+			if sameGroup && contiguous {
+				last.Range = length + 1
+				continue
+			}
+		}
+		migrated = append(migrated, define.PortMapping{
+			HostIP:        p.HostIP,
+			HostPort:      uint16(p.HostPort),
+			ContainerPort: uint16(p.ContainerPort),
+			Protocol:      p.Protocol,
+		})
+	}
+
+	return migrated
+}
+
+// loadPortMappingsInto unmarshals raw (a container config's stored port
+// mappings, in either schema) and stores the migrated result on c.config.
+// This is the method the BoltDB state driver calls while reading a
+// container's config out of its bucket.
+func (c *Container) loadPortMappingsInto(raw []byte) error {
+	mappings, err := loadPortMappings(raw)
+	if err != nil {
+		return err
+	}
+	c.config.PortMappings = mappings
+	return nil
+}
@@ -0,0 +1,68 @@
+package libpod
+
+import (
+	"testing"
+
+	"github.com/cri-o/ocicni/pkg/ocicni"
+)
+
+func TestLoadPortMappingsNilInput(t *testing.T) {
+	mappings, err := loadPortMappings(nil)
+	if err != nil || mappings != nil {
+		t.Fatalf("expected (nil, nil) for empty input, got (%+v, %v)", mappings, err)
+	}
+}
+
+func TestLoadPortMappingsCurrentSchema(t *testing.T) {
+	raw := []byte(`[{"container_port":80,"host_port":8080,"protocol":"tcp"}]`)
+
+	mappings, err := loadPortMappings(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mappings) != 1 || mappings[0].ContainerPort != 80 || mappings[0].HostPort != 8080 {
+		t.Fatalf("unexpected mappings: %+v", mappings)
+	}
+}
+
+func TestLoadPortMappingsMigratesLegacySchema(t *testing.T) {
+	raw := []byte(`[
+		{"hostPort":8080,"containerPort":80,"protocol":"tcp","hostIP":""},
+		{"hostPort":8081,"containerPort":81,"protocol":"tcp","hostIP":""}
+	]`)
+
+	mappings, err := loadPortMappings(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mappings) != 1 {
+		t.Fatalf("expected the contiguous legacy entries to collapse to 1 mapping, got %d: %+v", len(mappings), mappings)
+	}
+	if mappings[0].ContainerPort != 80 || mappings[0].HostPort != 8080 || mappings[0].Range != 2 {
+		t.Fatalf("unexpected migrated mapping: %+v", mappings[0])
+	}
+}
+
+func TestContainerLoadPortMappingsIntoStoresResult(t *testing.T) {
+	c := &Container{config: &ContainerConfig{}}
+	raw := []byte(`[{"hostPort":53,"containerPort":53,"protocol":"udp","hostIP":"127.0.0.1"}]`)
+
+	if err := c.loadPortMappingsInto(raw); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.config.PortMappings) != 1 || c.config.PortMappings[0].HostIP != "127.0.0.1" {
+		t.Fatalf("unexpected config after load: %+v", c.config.PortMappings)
+	}
+}
+
+func TestMigrateLegacyPortMappingsSplitsNonContiguousRuns(t *testing.T) {
+	legacy := []ocicni.PortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostPort: 9090, ContainerPort: 81, Protocol: "tcp"},
+	}
+
+	migrated := migrateLegacyPortMappings(legacy)
+	if len(migrated) != 2 {
+		t.Fatalf("expected non-contiguous legacy entries to stay separate, got %d: %+v", len(migrated), migrated)
+	}
+}
@@ -0,0 +1,35 @@
+package generate
+
+import (
+	"context"
+
+	"github.com/containers/libpod/libpod/define"
+	"github.com/containers/libpod/libpod/image"
+	"github.com/containers/libpod/pkg/cgroups"
+	"github.com/containers/libpod/pkg/specgen"
+)
+
+// validateCgroupMode rejects a spec generator's requested cgroup mode if
+// the host can't support it - today, that's only CgroupModeConmonDelegated
+// on a cgroup v1 host. This is the --cgroups validation that runs as part
+// of completing a SpecGenerator, before a container is created.
+func validateCgroupMode(s *specgen.SpecGenerator) error {
+	unified, err := cgroups.IsCgroup2UnifiedMode()
+	if err != nil {
+		return err
+	}
+	return define.ValidateCgroupMode(s.CgroupsMode, unified)
+}
+
+// CompleteSpec finishes resolving the parts of a SpecGenerator that need
+// validation or allocation against the host before a container can be
+// created from it: the requested cgroup mode, and the port mappings (and
+// exposed-port tracking) it will run with. It's the single entry point the
+// container creation path calls once a SpecGenerator has been otherwise
+// filled in.
+func CompleteSpec(ctx context.Context, s *specgen.SpecGenerator, img *image.Image) ([]define.PortMapping, map[uint16][]string, error) {
+	if err := validateCgroupMode(s); err != nil {
+		return nil, nil, err
+	}
+	return createPortMappings(ctx, s, img)
+}
@@ -0,0 +1,42 @@
+package generate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/libpod/libpod/define"
+	"github.com/containers/libpod/pkg/specgen"
+)
+
+func TestValidateCgroupModeAcceptsDefault(t *testing.T) {
+	s := &specgen.SpecGenerator{}
+	if err := validateCgroupMode(s); err != nil {
+		t.Fatalf("expected the default cgroup mode to always validate, got: %v", err)
+	}
+}
+
+func TestValidateCgroupModeRejectsDelegatedOnCgroupV1(t *testing.T) {
+	// define.ValidateCgroupMode is what actually applies the cgroup v1
+	// rejection; validateCgroupMode just wires the live
+	// cgroups.IsCgroup2UnifiedMode() result into it, which can't be
+	// forced to a particular value from a unit test running on
+	// whatever host CI happens to use. Exercise the rejection directly
+	// against the shared helper instead.
+	if err := define.ValidateCgroupMode(define.CgroupModeConmonDelegated, false); err == nil {
+		t.Fatalf("expected an error for conmon-delegated on cgroup v1")
+	}
+}
+
+func TestCompleteSpecValidatesCgroupModeThenParsesPorts(t *testing.T) {
+	s := &specgen.SpecGenerator{
+		PortMappings: []specgen.PortMapping{{ContainerPort: 80, HostPort: 8080, Protocol: protoTCP}},
+	}
+
+	mappings, _, err := CompleteSpec(context.Background(), s, nil)
+	if err != nil {
+		t.Fatalf("unexpected error for the default cgroup mode: %v", err)
+	}
+	if len(mappings) != 1 || mappings[0].ContainerPort != 80 {
+		t.Fatalf("expected CompleteSpec to return the parsed port mapping, got %+v", mappings)
+	}
+}
@@ -3,9 +3,11 @@ package generate
 import (
 	"context"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/containers/libpod/libpod/define"
 	"github.com/containers/libpod/libpod/image"
 	"github.com/containers/libpod/pkg/specgen"
 	"github.com/cri-o/ocicni/pkg/ocicni"
@@ -19,37 +21,138 @@ const (
 	protoSCTP = "sctp"
 )
 
-// Parse port maps to OCICNI port mappings.
-// Returns a set of OCICNI port mappings, and maps of utilized container and
-// host ports.
-func parsePortMapping(portMappings []specgen.PortMapping) ([]ocicni.PortMapping, map[string]map[string]map[uint16]uint16, map[string]map[string]map[uint16]uint16, error) {
-	// First, we need to validate the ports passed in the specgen, and then
-	// convert them into CNI port mappings.
-	finalMappings := []ocicni.PortMapping{}
-
-	// To validate, we need two maps: one for host ports, one for container
-	// ports.
-	// Each is a map of protocol to map of IP address to map of port to
-	// port (for hostPortValidate, it's host port to container port;
-	// for containerPortValidate, container port to host port.
-	// These will ensure no collisions.
-	hostPortValidate := make(map[string]map[string]map[uint16]uint16)
-	containerPortValidate := make(map[string]map[string]map[uint16]uint16)
-
-	// Initialize the first level of maps (we can't really guess keys for
-	// the rest).
+// portRange is a single contiguous run of ports forwarded to one host IP,
+// with a fixed offset between the container and host port numbers. It's
+// the unit parsePortMapping validates and collapses ranges into, so that a
+// `-p 1000-9000:1000-9000` is tracked (and ultimately stored) as one entry
+// instead of 8001.
+type portRange struct {
+	ctrStart, hostStart, length uint16
+	// origHostIP preserves the host IP string as requested (which may be
+	// the empty string) for output, separately from the normalized IP
+	// used to bucket ranges for collision checks.
+	origHostIP string
+}
+
+func (r portRange) ctrEnd() int  { return int(r.ctrStart) + int(r.length) - 1 }
+func (r portRange) hostEnd() int { return int(r.hostStart) + int(r.length) - 1 }
+func (r portRange) offset() int  { return int(r.hostStart) - int(r.ctrStart) }
+
+// overlaps returns whether r and other share any container port or any
+// host port.
+func (r portRange) overlaps(other portRange) bool {
+	ctrOverlap := int(r.ctrStart) <= other.ctrEnd() && int(other.ctrStart) <= r.ctrEnd()
+	hostOverlap := int(r.hostStart) <= other.hostEnd() && int(other.hostStart) <= r.hostEnd()
+	return ctrOverlap || hostOverlap
+}
+
+// adjacent returns whether r and other would become one contiguous range
+// if merged, i.e. one ends exactly where the other begins.
+func (r portRange) adjacent(other portRange) bool {
+	return r.ctrEnd()+1 == int(other.ctrStart) || other.ctrEnd()+1 == int(r.ctrStart)
+}
+
+// merge combines r and other, which must share an offset and either
+// overlap or be adjacent, into the smallest portRange covering both.
+func (r portRange) merge(other portRange) portRange {
+	ctrStart := r.ctrStart
+	if other.ctrStart < ctrStart {
+		ctrStart = other.ctrStart
+	}
+	ctrEnd := r.ctrEnd()
+	if other.ctrEnd() > ctrEnd {
+		ctrEnd = other.ctrEnd()
+	}
+	return portRange{
+		ctrStart:   ctrStart,
+		hostStart:  uint16(int(ctrStart) + r.offset()),
+		length:     uint16(ctrEnd - int(ctrStart) + 1),
+		origHostIP: r.origHostIP,
+	}
+}
+
+// insertPortRange inserts candidate into ranges (an unordered bucket of
+// ranges already claimed for one protocol+host IP). Two ranges only ever
+// interact in one of three ways:
+//   - They overlap (share a container or host port) with the same offset:
+//     redundant, so merge them.
+//   - They overlap with a different offset: a genuine conflict, since the
+//     same host (or container) port can't forward to two different
+//     container (or host) ports.
+//   - They're merely adjacent (one ends where the other begins) with the
+//     same offset: also merge them, so e.g. two `-p` flags for 80-84 and
+//     85-89 with the same host offset collapse into one 80-89 entry.
+//
+// Adjacency with a *different* offset is not a conflict - it's just two
+// independent, unrelated ranges that happen to sit next to each other
+// (e.g. ctr 80->host 8080 and ctr 81->host 9090) - so it falls through to
+// being inserted as its own separate range below.
+func insertPortRange(ranges []portRange, candidate portRange, proto string) ([]portRange, error) {
+	for merged := true; merged; {
+		merged = false
+		for i, r := range ranges {
+			sameOffset := candidate.offset() == r.offset()
+			switch {
+			case candidate.overlaps(r) && !sameOffset:
+				return nil, errors.Errorf("conflicting port mappings for protocol %s: container/host port offset does not match an existing mapping overlapping host port %d-%d", proto, r.hostStart, r.hostEnd())
+			case sameOffset && (candidate.overlaps(r) || candidate.adjacent(r)):
+				candidate = candidate.merge(r)
+				ranges = append(ranges[:i], ranges[i+1:]...)
+				merged = true
+			}
+			if merged {
+				break
+			}
+		}
+	}
+	ranges = append(ranges, candidate)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].ctrStart < ranges[j].ctrStart })
+	return ranges, nil
+}
+
+// containerPortTaken returns whether port falls within any range already
+// claimed on the container side.
+func containerPortTaken(ranges []portRange, port uint16) bool {
+	for _, r := range ranges {
+		if int(r.ctrStart) <= int(port) && int(port) <= r.ctrEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPortTaken returns whether port falls within any range already
+// claimed on the host side.
+func hostPortTaken(ranges []portRange, port uint16) bool {
+	for _, r := range ranges {
+		if int(r.hostStart) <= int(port) && int(port) <= r.hostEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePortMapping validates the port mappings passed in the specgen and
+// collapses them into the smallest possible set of define.PortMapping
+// ranges. Overlapping or adjacent ranges for the same protocol, host IP,
+// and container/host port offset are merged (and exact duplicates silently
+// dropped) rather than rejected; ranges that overlap with a different
+// offset are conflicts and return an error.
+//
+// Also returned is the set of ranges claimed per protocol and host IP,
+// which createPortMappings uses to check exposed ports for collisions
+// without re-validating everything from scratch.
+func parsePortMapping(portMappings []specgen.PortMapping) ([]define.PortMapping, map[string]map[string][]portRange, error) {
+	claimed := make(map[string]map[string][]portRange)
 	for _, proto := range []string{protoTCP, protoUDP, protoSCTP} {
-		hostPortValidate[proto] = make(map[string]map[uint16]uint16)
-		containerPortValidate[proto] = make(map[string]map[uint16]uint16)
+		claimed[proto] = make(map[string][]portRange)
 	}
 
-	// Iterate through all port mappings, generating OCICNI PortMapping
-	// structs and validating there is no overlap.
 	for _, port := range portMappings {
 		// First, check proto
 		protocols, err := checkProtocol(port.Protocol, true)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, err
 		}
 
 		// Validate host IP
@@ -58,110 +161,85 @@ func parsePortMapping(portMappings []specgen.PortMapping) ([]ocicni.PortMapping,
 			hostIP = "0.0.0.0"
 		}
 		if ip := net.ParseIP(hostIP); ip == nil {
-			return nil, nil, nil, errors.Errorf("invalid IP address %s in port mapping", port.HostIP)
+			return nil, nil, errors.Errorf("invalid IP address %s in port mapping", port.HostIP)
 		}
 
 		// Validate port numbers and range.
-		len := port.Range
-		if len == 0 {
-			len = 1
+		length := port.Range
+		if length == 0 {
+			length = 1
 		}
 		containerPort := port.ContainerPort
 		if containerPort == 0 {
-			return nil, nil, nil, errors.Errorf("container port number must be non-0")
+			return nil, nil, errors.Errorf("container port number must be non-0")
 		}
 		hostPort := port.HostPort
 		if hostPort == 0 {
 			hostPort = containerPort
 		}
-		if uint32(len-1)+uint32(containerPort) > 65535 {
-			return nil, nil, nil, errors.Errorf("container port range exceeds maximum allowable port number")
+		if uint32(length-1)+uint32(containerPort) > 65535 {
+			return nil, nil, errors.Errorf("container port range exceeds maximum allowable port number")
 		}
-		if uint32(len-1)+uint32(hostPort) > 65536 {
-			return nil, nil, nil, errors.Errorf("host port range exceeds maximum allowable port number")
+		if uint32(length-1)+uint32(hostPort) > 65535 {
+			return nil, nil, errors.Errorf("host port range exceeds maximum allowable port number")
 		}
 
-		// Iterate through ports, populating maps to check for conflicts
-		// and generating CNI port mappings.
-		for _, p := range protocols {
-			hostIPMap := hostPortValidate[p]
-			ctrIPMap := containerPortValidate[p]
+		candidate := portRange{
+			ctrStart:   containerPort,
+			hostStart:  hostPort,
+			length:     length,
+			origHostIP: port.HostIP,
+		}
 
-			hostPortMap, ok := hostIPMap[hostIP]
-			if !ok {
-				hostPortMap = make(map[uint16]uint16)
-				hostIPMap[hostIP] = hostPortMap
-			}
-			ctrPortMap, ok := ctrIPMap[hostIP]
-			if !ok {
-				ctrPortMap = make(map[uint16]uint16)
-				ctrIPMap[hostIP] = ctrPortMap
+		for _, p := range protocols {
+			ranges, err := insertPortRange(claimed[p][hostIP], candidate, p)
+			if err != nil {
+				return nil, nil, err
 			}
+			claimed[p][hostIP] = ranges
+		}
+	}
 
-			// Iterate through all port numbers in the requested
-			// range.
-			var index uint16
-			for index = 0; index < len; index++ {
-				cPort := containerPort + index
-				hPort := hostPort + index
-
-				if cPort == 0 || hPort == 0 {
-					return nil, nil, nil, errors.Errorf("host and container ports cannot be 0")
-				}
-
-				testCPort := ctrPortMap[cPort]
-				if testCPort != 0 && testCPort != hPort {
-					// This is an attempt to redefine a port
-					return nil, nil, nil, errors.Errorf("conflicting port mappings for container port %d (protocol %s)", cPort, p)
-				}
-				ctrPortMap[cPort] = hPort
-
-				testHPort := hostPortMap[hPort]
-				if testHPort != 0 && testHPort != cPort {
-					return nil, nil, nil, errors.Errorf("conflicting port mappings for host port %d (protocol %s)", hPort, p)
-				}
-				hostPortMap[hPort] = cPort
-
-				// If we have an exact duplicate, just continue
-				if testCPort == hPort && testHPort == cPort {
-					continue
-				}
-
-				// We appear to be clear. Make an OCICNI port
-				// struct.
-				// Don't use hostIP - we want to preserve the
-				// empty string hostIP by default for compat.
-				cniPort := ocicni.PortMapping{
-					HostPort:      int32(hPort),
-					ContainerPort: int32(cPort),
-					Protocol:      p,
-					HostIP:        port.HostIP,
+	finalMappings := []define.PortMapping{}
+	for _, proto := range []string{protoTCP, protoUDP, protoSCTP} {
+		for _, ranges := range claimed[proto] {
+			for _, r := range ranges {
+				// Don't use the normalized hostIP - we want to
+				// preserve the empty string hostIP by default
+				// for compat.
+				rangeLen := r.length
+				if rangeLen == 1 {
+					rangeLen = 0
 				}
-				finalMappings = append(finalMappings, cniPort)
+				finalMappings = append(finalMappings, define.PortMapping{
+					HostIP:        r.origHostIP,
+					ContainerPort: r.ctrStart,
+					HostPort:      r.hostStart,
+					Range:         rangeLen,
+					Protocol:      proto,
+				})
 			}
 		}
 	}
 
-	return finalMappings, containerPortValidate, hostPortValidate, nil
+	return finalMappings, claimed, nil
 }
 
-// Make final port mappings for the container
-func createPortMappings(ctx context.Context, s *specgen.SpecGenerator, img *image.Image) ([]ocicni.PortMapping, error) {
-	finalMappings, containerPortValidate, hostPortValidate, err := parsePortMapping(s.PortMappings)
+// Make final port mappings for the container, plus the set of ports the
+// container exposes (via --expose or the image's EXPOSE) independent of
+// whether any of them were actually published. The latter is tracked even
+// when nothing is published so that `podman commit` and `inspect` can still
+// report it - see define.FormatExposedPorts.
+func createPortMappings(ctx context.Context, s *specgen.SpecGenerator, img *image.Image) ([]define.PortMapping, map[uint16][]string, error) {
+	finalMappings, claimed, err := parsePortMapping(s.PortMappings)
 	if err != nil {
-		return nil, err
-	}
-
-	// If not publishing exposed ports, or if we are publishing and there is
-	// nothing to publish - then just return the port mappings we've made so
-	// far.
-	if !s.PublishExposedPorts || (len(s.Expose) == 0 && img == nil) {
-		return finalMappings, nil
+		return nil, nil, err
 	}
 
-	logrus.Debugf("Adding exposed ports")
-
-	// We need to merge s.Expose into image exposed ports
+	// We need to merge s.Expose into image exposed ports. This happens
+	// regardless of PublishExposedPorts - we always want to know what the
+	// container advertises, even if we aren't binding any of it to the
+	// host.
 	expose := make(map[uint16]string)
 	for k, v := range s.Expose {
 		expose[k] = v
@@ -169,17 +247,17 @@ func createPortMappings(ctx context.Context, s *specgen.SpecGenerator, img *imag
 	if img != nil {
 		inspect, err := img.InspectNoSize(ctx)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error inspecting image to get exposed ports")
+			return nil, nil, errors.Wrapf(err, "error inspecting image to get exposed ports")
 		}
 		for imgExpose := range inspect.Config.ExposedPorts {
 			// Expose format is portNumber[/protocol]
 			splitExpose := strings.SplitN(imgExpose, "/", 2)
 			num, err := strconv.Atoi(splitExpose[0])
 			if err != nil {
-				return nil, errors.Wrapf(err, "unable to convert image EXPOSE statement %q to port number", imgExpose)
+				return nil, nil, errors.Wrapf(err, "unable to convert image EXPOSE statement %q to port number", imgExpose)
 			}
 			if num > 65535 || num < 1 {
-				return nil, errors.Errorf("%d from image EXPOSE statement %q is not a valid port number", num, imgExpose)
+				return nil, nil, errors.Errorf("%d from image EXPOSE statement %q is not a valid port number", num, imgExpose)
 			}
 			// No need to validate protocol, we'll do it below.
 			if len(splitExpose) == 1 {
@@ -190,38 +268,38 @@ func createPortMappings(ctx context.Context, s *specgen.SpecGenerator, img *imag
 		}
 	}
 
-	// There's been a request to expose some ports. Let's do that.
-	// Start by figuring out what needs to be exposed.
-	// This is a map of container port number to protocols to expose.
-	toExpose := make(map[uint16][]string)
+	// Record what's exposed, regardless of whether we're publishing it.
+	exposedPorts := make(map[uint16][]string)
 	for port, proto := range expose {
-		// Validate protocol first
 		protocols, err := checkProtocol(proto, false)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error validating protocols for exposed port %d", port)
+			return nil, nil, errors.Wrapf(err, "error validating protocols for exposed port %d", port)
 		}
-
 		if port == 0 {
-			return nil, errors.Errorf("cannot expose 0 as it is not a valid port number")
+			return nil, nil, errors.Errorf("cannot expose 0 as it is not a valid port number")
 		}
+		exposedPorts[port] = protocols
+	}
+
+	// If not publishing exposed ports, or if we are publishing and there is
+	// nothing to publish - then just return what we've made so far.
+	if !s.PublishExposedPorts || len(exposedPorts) == 0 {
+		return finalMappings, exposedPorts, nil
+	}
 
+	logrus.Debugf("Adding exposed ports")
+
+	// There's been a request to expose some ports. Let's do that.
+	// Start by figuring out what needs to be published.
+	// This is a map of container port number to protocols to publish.
+	toExpose := make(map[uint16][]string)
+	for port, protocols := range exposedPorts {
 		// Check to see if the port is already present in existing
 		// mappings.
 		for _, p := range protocols {
-			ctrPortMap, ok := containerPortValidate[p]["0.0.0.0"]
-			if !ok {
-				ctrPortMap = make(map[uint16]uint16)
-				containerPortValidate[p]["0.0.0.0"] = ctrPortMap
-			}
-
-			if portNum := ctrPortMap[port]; portNum == 0 {
+			if !containerPortTaken(claimed[p]["0.0.0.0"], port) {
 				// We want to expose this port for this protocol
-				exposeProto, ok := toExpose[port]
-				if !ok {
-					exposeProto = []string{}
-				}
-				exposeProto = append(exposeProto, p)
-				toExpose[port] = exposeProto
+				toExpose[port] = append(toExpose[port], p)
 			}
 		}
 	}
@@ -241,43 +319,58 @@ func createPortMappings(ctx context.Context, s *specgen.SpecGenerator, img *imag
 				// unfortunate for the UDP case.
 				candidate, err := getRandomPort()
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 
 				// Check if the host port is already bound
-				hostPortMap, ok := hostPortValidate[p]["0.0.0.0"]
-				if !ok {
-					hostPortMap = make(map[uint16]uint16)
-					hostPortValidate[p]["0.0.0.0"] = hostPortMap
-				}
-
-				if checkPort := hostPortMap[uint16(candidate)]; checkPort != 0 {
+				if hostPortTaken(claimed[p]["0.0.0.0"], uint16(candidate)) {
 					// Host port is already allocated, try again
 					tries--
 					continue
 				}
 
-				hostPortMap[uint16(candidate)] = port
+				claimed[p]["0.0.0.0"] = append(claimed[p]["0.0.0.0"], portRange{ctrStart: port, hostStart: uint16(candidate), length: 1})
 				hostPort = candidate
 				logrus.Debugf("Mapping exposed port %d/%s to host port %d", port, p, hostPort)
 
-				// Make a CNI port mapping
-				cniPort := ocicni.PortMapping{
-					HostPort:      int32(candidate),
-					ContainerPort: int32(port),
+				finalMappings = append(finalMappings, define.PortMapping{
+					HostPort:      uint16(candidate),
+					ContainerPort: port,
 					Protocol:      p,
 					HostIP:        "",
-				}
-				finalMappings = append(finalMappings, cniPort)
+				})
 			}
 			if tries == 0 && hostPort == 0 {
 				// We failed to find an open port.
-				return nil, errors.Errorf("failed to find an open port to expose container port %d on the host", port)
+				return nil, nil, errors.Errorf("failed to find an open port to expose container port %d on the host", port)
 			}
 		}
 	}
 
-	return finalMappings, nil
+	return finalMappings, exposedPorts, nil
+}
+
+// ToOCICNIPortMappings flattens a set of range-aware define.PortMapping
+// entries back into one ocicni.PortMapping per port. This is needed at the
+// CNI / netavark / rootlessport boundary, which only understands individual
+// ports - everywhere else should carry the range-aware form.
+func ToOCICNIPortMappings(mappings []define.PortMapping) []ocicni.PortMapping {
+	flattened := []ocicni.PortMapping{}
+	for _, m := range mappings {
+		length := m.Range
+		if length == 0 {
+			length = 1
+		}
+		for i := uint16(0); i < length; i++ {
+			flattened = append(flattened, ocicni.PortMapping{
+				HostPort:      int32(m.HostPort + i),
+				ContainerPort: int32(m.ContainerPort + i),
+				Protocol:      m.Protocol,
+				HostIP:        m.HostIP,
+			})
+		}
+	}
+	return flattened
 }
 
 // Check a string to ensure it is a comma-separated set of valid protocols
@@ -330,4 +423,4 @@ func getRandomPort() (int, error) {
 		return 0, errors.Wrapf(err, "unable to convert random port to int")
 	}
 	return rp, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,63 @@
+package generate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/containers/libpod/pkg/specgen"
+)
+
+// buildBenchPortMappings builds n port mappings spread across tcp/udp/sctp
+// and a mix of IPv4/IPv6 host IPs, with every third entry (each of which
+// lands on tcp) a 4-port range and the rest single ports, and with each
+// (protocol, host IP) bucket getting its own
+// non-overlapping run of ports so parsePortMapping never rejects the set.
+func buildBenchPortMappings(n int) []specgen.PortMapping {
+	protocols := []string{protoTCP, protoUDP, protoSCTP}
+	hostIPs := []string{"", "127.0.0.1", "::1"}
+
+	type bucketKey struct {
+		proto, ip string
+	}
+	next := make(map[bucketKey]uint16)
+
+	mappings := make([]specgen.PortMapping, 0, n)
+	for i := 0; i < n; i++ {
+		key := bucketKey{proto: protocols[i%len(protocols)], ip: hostIPs[(i/len(protocols))%len(hostIPs)]}
+
+		rangeLen := uint16(0)
+		if i%3 == 0 {
+			rangeLen = 4
+		}
+		length := rangeLen
+		if length == 0 {
+			length = 1
+		}
+
+		port := next[key] + 1
+		next[key] = port + length - 1
+
+		mappings = append(mappings, specgen.PortMapping{
+			HostIP:        key.ip,
+			ContainerPort: port,
+			HostPort:      port,
+			Range:         rangeLen,
+			Protocol:      key.proto,
+		})
+	}
+	return mappings
+}
+
+func BenchmarkParsePortMapping(b *testing.B) {
+	for _, n := range []int{1, 100, 1000, 10000} {
+		mappings := buildBenchPortMappings(n)
+		b.Run(fmt.Sprintf("entries-%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := parsePortMapping(mappings); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package generate
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/containers/libpod/pkg/specgen"
+)
+
+func randomPortMapping(r *rand.Rand) specgen.PortMapping {
+	protocols := []string{protoTCP, protoUDP, protoSCTP}
+	hostIPs := []string{"", "127.0.0.1", "::1"}
+
+	ctrPort := uint16(1 + r.Intn(60000))
+	hostPort := ctrPort + uint16(r.Intn(3))
+
+	rangeLen := uint16(0)
+	if r.Intn(3) == 0 {
+		rangeLen = uint16(1 + r.Intn(20))
+	}
+
+	return specgen.PortMapping{
+		HostIP:        hostIPs[r.Intn(len(hostIPs))],
+		ContainerPort: ctrPort,
+		HostPort:      hostPort,
+		Range:         rangeLen,
+		Protocol:      protocols[r.Intn(len(protocols))],
+	}
+}
+
+// TestParsePortMappingRandomSets generates random, possibly-overlapping
+// port-mapping sets and, whenever parsePortMapping accepts one, checks that
+// the flattened result is internally consistent: no host (ip, proto, port)
+// tuple appears twice, and every requested container port made it into the
+// output.
+func TestParsePortMappingRandomSets(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		n := 1 + r.Intn(12)
+		mappings := make([]specgen.PortMapping, n)
+		for j := range mappings {
+			mappings[j] = randomPortMapping(r)
+		}
+
+		final, _, err := parsePortMapping(mappings)
+		if err != nil {
+			// Conflicting random input is expected; nothing to check.
+			continue
+		}
+
+		flattened := ToOCICNIPortMappings(final)
+
+		seenHost := make(map[string]bool)
+		for _, p := range flattened {
+			key := fmt.Sprintf("%s|%s|%d", p.Protocol, p.HostIP, p.HostPort)
+			if seenHost[key] {
+				t.Fatalf("duplicate host tuple %s in flattened output for input %+v", key, mappings)
+			}
+			seenHost[key] = true
+		}
+
+		for _, in := range mappings {
+			length := in.Range
+			if length == 0 {
+				length = 1
+			}
+			for k := uint16(0); k < length; k++ {
+				want := int32(in.ContainerPort + k)
+				found := false
+				for _, p := range flattened {
+					if p.ContainerPort == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Fatalf("container port %d from input %+v missing from flattened output", want, in)
+				}
+			}
+		}
+	}
+}
+
+// TestParsePortMappingAcceptsAdjacentDifferentOffsets verifies that two
+// independent mappings whose container ports happen to be adjacent, but
+// whose host ports are unrelated (different offsets, no actual overlap),
+// are both accepted rather than rejected as a conflict.
+func TestParsePortMappingAcceptsAdjacentDifferentOffsets(t *testing.T) {
+	mappings := []specgen.PortMapping{
+		{ContainerPort: 80, HostPort: 8080, Protocol: protoTCP},
+		{ContainerPort: 81, HostPort: 9090, Protocol: protoTCP},
+	}
+
+	final, _, err := parsePortMapping(mappings)
+	if err != nil {
+		t.Fatalf("expected adjacent mappings with different offsets to be accepted, got error: %v", err)
+	}
+	if len(final) != 2 {
+		t.Fatalf("expected both mappings to be kept as independent ranges, got %d: %+v", len(final), final)
+	}
+}
+
+// TestParsePortMappingAcceptsDisjointMappings verifies that a set of
+// mappings which don't overlap or touch at all - spread across protocols
+// and host IPs - is accepted outright. TestParsePortMappingRandomSets
+// can't guarantee this on its own: it treats every error as expected
+// conflicting input and moves on, so it never actually asserts that a
+// known-good set of mappings succeeds.
+func TestParsePortMappingAcceptsDisjointMappings(t *testing.T) {
+	mappings := []specgen.PortMapping{
+		{ContainerPort: 80, HostPort: 8080, Protocol: protoTCP},
+		{ContainerPort: 443, HostPort: 8443, Protocol: protoTCP},
+		{ContainerPort: 80, HostPort: 8080, Protocol: protoUDP},
+		{ContainerPort: 53, HostPort: 5300, Protocol: protoUDP, HostIP: "127.0.0.1"},
+		{ContainerPort: 53, HostPort: 5301, Protocol: protoUDP, HostIP: "::1"},
+	}
+
+	final, _, err := parsePortMapping(mappings)
+	if err != nil {
+		t.Fatalf("expected disjoint, non-adjacent mappings to be accepted, got error: %v", err)
+	}
+	if len(final) != len(mappings) {
+		t.Fatalf("expected all %d disjoint mappings to be kept, got %d: %+v", len(mappings), len(final), final)
+	}
+}
+
+// TestParsePortMappingDeduplicatesIdenticalInputs verifies that feeding in
+// exact duplicates of the same port mapping is silently folded into a
+// single entry rather than rejected as a conflict.
+func TestParsePortMappingDeduplicatesIdenticalInputs(t *testing.T) {
+	mapping := specgen.PortMapping{ContainerPort: 8080, HostPort: 8080, Range: 10, Protocol: protoTCP}
+
+	final, _, err := parsePortMapping([]specgen.PortMapping{mapping, mapping, mapping})
+	if err != nil {
+		t.Fatalf("expected duplicate identical mappings to be deduplicated, got error: %v", err)
+	}
+	if len(final) != 1 {
+		t.Fatalf("expected duplicate mappings to collapse to a single entry, got %d: %+v", len(final), final)
+	}
+	if final[0].Range != 10 || final[0].ContainerPort != 8080 {
+		t.Fatalf("unexpected collapsed mapping: %+v", final[0])
+	}
+}
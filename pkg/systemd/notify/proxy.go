@@ -0,0 +1,194 @@
+// Package notify implements a small sd_notify proxy. It listens on a
+// unixgram socket meant to be injected into a container as NOTIFY_SOCKET,
+// parses the datagrams the container's init sends there, and forwards the
+// ones systemd understands (READY=1, STATUS=, RELOADING=1, STOPPING=1,
+// WATCHDOG=1, MAINPID=) on to the NOTIFY_SOCKET podman itself inherited
+// from systemd - rewriting MAINPID= to conmon's PID when podman is running
+// with --sdnotify=conmon.
+package notify
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Mode selects how MAINPID= is handled as messages are forwarded upstream.
+type Mode string
+
+const (
+	// ModeConmon rewrites MAINPID= to conmon's PID, so systemd treats
+	// conmon as the service's main process.
+	ModeConmon Mode = "conmon"
+	// ModeContainer passes MAINPID= through unmodified - the container's
+	// own init is the service's main process.
+	ModeContainer Mode = "container"
+)
+
+// Proxy owns a child NOTIFY_SOCKET meant to be injected into a container,
+// and forwards what it reads there up to the NOTIFY_SOCKET podman itself
+// was started under.
+type Proxy struct {
+	// Socket is the listening end of the proxy's notify socket.
+	Socket *net.UnixConn
+	// SocketPath is the path of Socket, suitable for passing to a
+	// container as its NOTIFY_SOCKET.
+	SocketPath string
+
+	mode      Mode
+	conmonPID int
+	upstream  string
+
+	// statusMu guards status, readyCount and mainPIDs, which handle (run
+	// from Run's goroutine) writes and Status/ReadyCount/MainPIDs (called
+	// from whatever goroutine podman ps/inspect is running on) read.
+	statusMu   sync.Mutex
+	status     string
+	readyCount int
+	mainPIDs   []int
+
+	done chan struct{}
+	err  error
+}
+
+// NewProxy creates a Proxy listening on a fresh unixgram socket at
+// socketPath. upstream is the NOTIFY_SOCKET inherited from systemd that
+// recognized messages are forwarded to; it may be empty, in which case
+// messages are parsed and tracked but nothing is forwarded anywhere.
+func NewProxy(socketPath string, mode Mode, conmonPID int, upstream string) (*Proxy, error) {
+	addr := net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	socket, err := net.ListenUnixgram("unixgram", &addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating notify socket %q", socketPath)
+	}
+	return &Proxy{
+		Socket:     socket,
+		SocketPath: socketPath,
+		mode:       mode,
+		conmonPID:  conmonPID,
+		upstream:   upstream,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Run reads datagrams from the proxy's socket, forwarding recognized
+// sd_notify fields upstream, until the socket is closed (via Close) or a
+// read fails for some other reason. It's meant to be run in its own
+// goroutine; call Wait to block until it has returned.
+func (p *Proxy) Run() {
+	defer close(p.done)
+	var buf [4096]byte
+	for {
+		if err := p.Socket.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				p.err = err
+			}
+			return
+		}
+		n, err := p.Socket.Read(buf[:])
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				continue
+			}
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				p.err = err
+			}
+			return
+		}
+		if n <= 0 {
+			continue
+		}
+		p.handle(string(buf[:n]))
+	}
+}
+
+// handle parses one datagram's worth of sd_notify fields, tracks the ones
+// libpod cares about, and forwards the recognized subset upstream.
+func (p *Proxy) handle(data string) {
+	var forward []string
+	p.statusMu.Lock()
+	for _, field := range strings.Split(data, "\n") {
+		if field == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(field, "MAINPID="):
+			if pid, err := strconv.Atoi(strings.TrimPrefix(field, "MAINPID=")); err == nil {
+				p.mainPIDs = append(p.mainPIDs, pid)
+			}
+			if p.mode == ModeConmon {
+				field = fmt.Sprintf("MAINPID=%d", p.conmonPID)
+			}
+			forward = append(forward, field)
+		case field == "READY=1":
+			p.readyCount++
+			forward = append(forward, field)
+		case strings.HasPrefix(field, "STATUS="):
+			p.status = strings.TrimPrefix(field, "STATUS=")
+			forward = append(forward, field)
+		case field == "RELOADING=1", field == "STOPPING=1", strings.HasPrefix(field, "WATCHDOG="):
+			forward = append(forward, field)
+		default:
+			logrus.Debugf("sdnotify proxy: ignoring unrecognized field %q", field)
+		}
+	}
+	p.statusMu.Unlock()
+	if len(forward) == 0 || p.upstream == "" {
+		return
+	}
+	if err := sendTo(p.upstream, strings.Join(forward, "\n")); err != nil {
+		logrus.Errorf("error forwarding sdnotify message to %q: %v", p.upstream, err)
+	}
+}
+
+// Status returns the most recent STATUS= string seen, for `podman ps` /
+// `inspect` to display.
+func (p *Proxy) Status() string {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return p.status
+}
+
+// ReadyCount returns the number of READY=1 messages seen so far.
+func (p *Proxy) ReadyCount() int {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return p.readyCount
+}
+
+// MainPIDs returns every MAINPID= value seen so far, in the order received
+// and before any conmon-mode rewrite.
+func (p *Proxy) MainPIDs() []int {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return append([]int(nil), p.mainPIDs...)
+}
+
+// Wait blocks until Run has returned, then returns the error (if any) that
+// stopped it. A normal Close does not count as an error.
+func (p *Proxy) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Close closes the proxy's socket, which causes a running Run to return.
+func (p *Proxy) Close() error {
+	return p.Socket.Close()
+}
+
+func sendTo(socketPath, msg string) error {
+	addr := net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, &addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(msg))
+	return err
+}
@@ -0,0 +1,88 @@
+// +build !remoteclient
+
+package integration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/libpod/pkg/cgroups"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Podman run with conmon-delegated cgroups", func() {
+	var (
+		tempdir    string
+		err        error
+		podmanTest *PodmanTestIntegration
+	)
+
+	BeforeEach(func() {
+		tempdir, err = CreateTempDirInTempDir()
+		if err != nil {
+			os.Exit(1)
+		}
+		podmanTest = PodmanTestCreate(tempdir)
+		podmanTest.Setup()
+		podmanTest.SeedImages()
+	})
+
+	AfterEach(func() {
+		podmanTest.Cleanup()
+		f := CurrentGinkgoTestDescription()
+		processTestResult(f)
+	})
+
+	It("podman run --cgroups=conmon-delegated puts conmon and the container under one scope", func() {
+		SkipIfRemote()
+
+		unified, err := cgroups.IsCgroup2UnifiedMode()
+		Expect(err).To(BeNil())
+		if !unified {
+			Skip("conmon-delegated cgroups require cgroup v2")
+		}
+
+		session := podmanTest.Podman([]string{"run", "-d", "--cgroups=conmon-delegated", ALPINE, "top"})
+		session.WaitWithDefaultTimeout()
+		Expect(session.ExitCode()).To(Equal(0))
+		ctrID := session.OutputToString()
+
+		inspectConmon := podmanTest.Podman([]string{"inspect", "--format", "{{.State.ConmonPid}}", ctrID})
+		inspectConmon.WaitWithDefaultTimeout()
+		Expect(inspectConmon.ExitCode()).To(Equal(0))
+		conmonPid := strings.TrimSpace(inspectConmon.OutputToString())
+
+		inspectCtr := podmanTest.Podman([]string{"inspect", "--format", "{{.State.Pid}}", ctrID})
+		inspectCtr.WaitWithDefaultTimeout()
+		Expect(inspectCtr.ExitCode()).To(Equal(0))
+		ctrPid := strings.TrimSpace(inspectCtr.OutputToString())
+
+		conmonCgroup := cgroupOf(conmonPid)
+		ctrCgroup := cgroupOf(ctrPid)
+
+		Expect(conmonCgroup).ToNot(BeEmpty())
+		Expect(ctrCgroup).To(HavePrefix(conmonCgroup))
+
+		stop := podmanTest.Podman([]string{"rm", "-f", ctrID})
+		stop.WaitWithDefaultTimeout()
+		Expect(stop.ExitCode()).To(Equal(0))
+	})
+})
+
+// cgroupOf reads the unified (cgroup v2) cgroup membership of a pid out of
+// /proc, matching the 0::<path> line format.
+func cgroupOf(pid string) string {
+	data, err := ioutil.ReadFile(filepath.Join("/proc", pid, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::")
+		}
+	}
+	return ""
+}
@@ -3,14 +3,12 @@
 package integration
 
 import (
-	"errors"
-	"fmt"
 	"net"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
+	"strconv"
 
+	"github.com/containers/libpod/pkg/systemd/notify"
 	. "github.com/containers/libpod/test/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -71,26 +69,22 @@ var _ = Describe("Podman sdnotify types", func() {
 		Expect(pull.ExitCode()).To(Equal(0))
 
 		sock := filepath.Join(tempdir, "notify")
-		state, err := collectNotifyData(sock)
+		proxy, err := notify.NewProxy(sock, notify.ModeContainer, 0, "")
 		Expect(err).To(BeNil())
 		defer os.Remove(sock)
-		defer state.socket.Close()
-
-		state.podmanExited = false
+		go proxy.Run()
 
 		os.Setenv("NOTIFY_SOCKET", sock)
 		defer os.Unsetenv("NOTIFY_SOCKET")
 
 		session := podmanTest.Podman([]string{"run", systemdImage, "sh", "-c", "ls -ld $NOTIFY_SOCKET; systemd-notify --ready; printenv NOTIFY_SOCKET"})
 		session.WaitWithDefaultTimeout()
-		state.podmanExited = true
-		<-state.doneChannel
+		proxy.Close()
+		Expect(proxy.Wait()).To(BeNil())
 
 		Expect(session.ExitCode()).To(Equal(0))
-		Expect(state.sawConmon).To(Equal(2))
-		Expect(state.sawReady).To(Equal(1))
-		Expect(state.err).ToNot(BeNil())
-		Expect(state.err.Error()).To(Equal("OK"))
+		Expect(sawConmonMainPID(proxy)).To(Equal(2))
+		Expect(proxy.ReadyCount()).To(Equal(1))
 		Expect(len(session.OutputToStringArray())).To(BeNumerically(">", 0))
 	})
 
@@ -103,101 +97,37 @@ var _ = Describe("Podman sdnotify types", func() {
 		Expect(pull.ExitCode()).To(Equal(0))
 
 		sock := filepath.Join(tempdir, "notify")
-		state, err := collectNotifyData(sock)
+		proxy, err := notify.NewProxy(sock, notify.ModeContainer, 0, "")
 		Expect(err).To(BeNil())
 		defer os.Remove(sock)
-		defer state.socket.Close()
-
-		state.podmanExited = false
+		go proxy.Run()
 
 		os.Setenv("NOTIFY_SOCKET", sock)
 		defer os.Unsetenv("NOTIFY_SOCKET")
 
 		session := podmanTest.Podman([]string{"run", "--sdnotify", "conmon", ALPINE, "printenv", "NOTIFY_SOCKET"})
 		session.WaitWithDefaultTimeout()
-		state.podmanExited = true
-		// Wait for collector
-		<-state.doneChannel
+		proxy.Close()
+		Expect(proxy.Wait()).To(BeNil())
 
 		Expect(session.ExitCode()).To(Equal(1))
-		Expect(state.sawConmon).To(Equal(2))
-		Expect(state.sawReady).To(Equal(1))
-		Expect(state.err).ToNot(BeNil())
-		Expect(state.err.Error()).To(Equal("OK"))
+		Expect(sawConmonMainPID(proxy)).To(Equal(2))
+		Expect(proxy.ReadyCount()).To(Equal(1))
 		Expect(len(session.OutputToStringArray())).To(Equal(0))
 	})
 })
 
-type notifyState struct {
-	socket       *net.UnixConn
-	podmanExited bool
-	sawConmon    int
-	sawMainpid   int
-	sawReady     int
-	err          error
-	doneChannel  chan bool
-}
-
-// Manage the notify socket
-// Count the MAINPID and READY messages
-// Verify they point at podman
-// Report errors
-func collectNotifyData(sockpath string) (*notifyState, error) {
-	state := notifyState{nil, false, 0, 0, 0, nil, make(chan bool)}
-
-	addr := net.UnixAddr{
-		Name: sockpath,
-		Net:  "unixgram",
-	}
-	socket, err := net.ListenUnixgram("unixgram", &addr)
-	state.socket = socket
-	if err != nil {
-		return &state, err
-	}
-	go func() {
-		var buf [1024]byte
-		last := false
-		for {
-			state.socket.SetReadDeadline(time.Now().Add(2 * time.Second))
-
-			n, err := state.socket.Read(buf[:])
-			if err != nil {
-				if e, ok := err.(net.Error); !ok || !e.Timeout() {
-					// handle error, it's not a timeout
-					state.err = err
-					break
-				}
-				if last {
-					state.err = errors.New("OK")
-					break
-				}
-				last = state.podmanExited
-				continue
-			}
-			if n <= 0 {
-				state.err = errors.New("End of File")
-				break
-			}
-
-			s := string(buf[:n])
-			for _, field := range strings.Split(s, "\n") {
-				fmt.Println(field)
-				if len(field) > 0 {
-					if strings.HasPrefix(field, "MAINPID=") {
-						state.sawMainpid++
-						pid := field[8:]
-						l, err := os.Readlink(filepath.Join("/proc/", pid, "/exe"))
-						if err == nil && filepath.Base(l) == "conmon" {
-							state.sawConmon++
-						}
-					} else if field == "READY=1" {
-						state.sawReady++
-					}
-				}
-			}
+// sawConmonMainPID counts how many of the MAINPID values the proxy
+// observed actually point at a conmon process, confirming that conmon (and
+// not podman or the container payload) is the one systemd would treat as
+// the service's main process.
+func sawConmonMainPID(proxy *notify.Proxy) int {
+	count := 0
+	for _, pid := range proxy.MainPIDs() {
+		l, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+		if err == nil && filepath.Base(l) == "conmon" {
+			count++
 		}
-		state.doneChannel <- true
-	}()
-
-	return &state, nil
+	}
+	return count
 }
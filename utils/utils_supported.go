@@ -53,6 +53,18 @@ func RunUnderSystemdScope(pid int, slice string, unitName string) error {
 	return nil
 }
 
+// RunUnderSystemdScopeDelegated starts pid in a transient systemd scope
+// exactly like RunUnderSystemdScope, then additionally reads back the
+// scope's cgroupfs path. It's used for the conmon-delegated cgroup mode,
+// where a caller needs to nest the container payload's cgroup inside
+// conmon's scope instead of creating a sibling scope for it.
+func RunUnderSystemdScopeDelegated(pid int, slice, unitName string) (string, error) {
+	if err := RunUnderSystemdScope(pid, slice, unitName); err != nil {
+		return "", err
+	}
+	return GetPidCgroupv2(pid)
+}
+
 // GetPidCgroupv2 returns the unified cgroup for the specified pid.
 func GetPidCgroupv2(pid int) (string, error) {
 	if pid == 0 {
@@ -8,6 +8,10 @@ func RunUnderSystemdScope(pid int, slice string, unitName string) error {
 	return errors.New("not implemented for windows")
 }
 
+func RunUnderSystemdScopeDelegated(pid int, slice, unitName string) (string, error) {
+	return "", errors.New("not implemented for windows")
+}
+
 func MoveUnderCgroup2Subtree(subtree string) error {
 	return errors.New("not implemented for windows")
 }